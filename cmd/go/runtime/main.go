@@ -17,26 +17,73 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"sort"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/env"
 	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/golang"
 	"github.com/GoogleCloudPlatform/buildpacks/pkg/runtime"
+	"golang.org/x/mod/semver"
 )
 
 const (
-	// goVersionURL is a URL to a JSON file that contains the latest Go version names.
-	goVersionURL    = "https://golang.org/dl/?mode=json"
-	goAltVersionURL = "https://golang.google.cn/dl/?mode=json"
-	goURL           = "https://dl.google.com/go/go%s.linux-amd64.tar.gz"
-	goAltURL        = "https://golang.google.cn/dl/go%s.linux-amd64.tar.gz"
-	goLayer         = "go"
-	versionKey      = "version"
+	// goVersionURL is a URL to a JSON file that contains Go version names and
+	// their release files. include=all is required so older, out-of-support
+	// releases are still listed; the default feed only lists the newest
+	// couple of minor series.
+	goVersionURL    = "https://golang.org/dl/?mode=json&include=all"
+	goAltVersionURL = "https://golang.google.cn/dl/?mode=json&include=all"
+	// goURL and goAltURL take the archive's filename (e.g.
+	// "go1.21.3.linux-amd64.tar.gz" or "go1.21.3.windows-amd64.zip"), as
+	// resolved from the version feed.
+	goURL      = "https://dl.google.com/go/%s"
+	goAltURL   = "https://golang.google.cn/dl/%s"
+	goLayer    = "go"
+	versionKey = "version"
+	sha256Key  = "sha256"
+
+	// goArchEnv and goOSEnv override the Go archive's target architecture and
+	// OS; they default to the builder's own runtime.GOARCH/runtime.GOOS.
+	goArchEnv = "GOOGLE_GO_ARCH"
+	goOSEnv   = "GOOGLE_GO_OS"
+
+	// goToolchainEnv mirrors the go command's own GOTOOLCHAIN env var:
+	// "auto" (default) uses go.mod's toolchain directive when it asks for a
+	// newer toolchain than the go directive, "local" disables toolchain
+	// resolution, and "goX.Y.Z" pins an exact toolchain.
+	goToolchainEnv = "GOTOOLCHAIN"
+
+	// goEnforceSupportedEnv, when "true", turns the out-of-support warning
+	// from supportPolicy into a build failure.
+	goEnforceSupportedEnv = "GOOGLE_GO_ENFORCE_SUPPORTED"
+
+	// supportedSeriesCount is the number of most-recent minor series the Go
+	// team actively supports at any given time.
+	supportedSeriesCount = 2
+
+	// goMirrorEnv is a comma-separated list of archive URL templates (each
+	// with %s placeholders for version, OS, and arch, in that order) tried
+	// before the default Google-hosted CDNs, for air-gapped/proxied builds.
+	goMirrorEnv = "GOOGLE_GO_MIRROR"
+
+	// goArchivePathEnv points to a pre-downloaded Go archive on disk, which is
+	// installed instead of downloading one. Its checksum is checked against
+	// the version feed when the feed can be reached.
+	goArchivePathEnv = "GOOGLE_GO_ARCHIVE_PATH"
+
+	// goVersionManifestURLEnv overrides the URL of the JSON version list so it
+	// too can be served from a mirror.
+	goVersionManifestURLEnv = "GOOGLE_GO_VERSION_MANIFEST_URL"
 )
 
 func main() {
@@ -55,54 +102,393 @@ func detectFn(ctx *gcp.Context) (gcp.DetectResult, error) {
 }
 
 func buildFn(ctx *gcp.Context) error {
-	version, err := runtimeVersion(ctx)
+	// feed is shared by every helper below that needs the version manifest,
+	// so a build only ever downloads it once instead of once per helper.
+	feed := newReleaseFeed(ctx)
+
+	version, err := runtimeVersion(ctx, feed)
 	if err != nil {
 		return err
 	}
 	grl := ctx.Layer(goLayer, gcp.BuildLayer, gcp.CacheLayer, gcp.LaunchLayerIfDevMode)
 
-	// Check metadata layer to see if correct version of Go is already installed.
+	// Check metadata layer to see if correct version of Go is already
+	// installed, and that its checksum still matches the version feed. This
+	// only re-verifies against a feed already fetched above for some other
+	// reason -- a cache hit never fetches one of its own.
 	metaVersion := ctx.GetMetadata(grl, versionKey)
-	if version == metaVersion {
+	metaSHA256 := ctx.GetMetadata(grl, sha256Key)
+	if version == metaVersion && cachedSHA256Valid(feed, version, metaSHA256) {
 		ctx.CacheHit(goLayer)
 	} else {
 		ctx.CacheMiss(goLayer)
 		ctx.ClearLayer(grl)
 
-		var finalArchiveURL string
-		archiveURL := fmt.Sprintf(goURL, version)
-		archiveAltURL := fmt.Sprintf(goAltURL, version)
+		goos, goarch := goPlatform()
 
-		if code := ctx.HTTPStatus(archiveURL); code != http.StatusOK {
-			ctx.Logf("Runtime version %s does not exist at %s (status %d). You can specify the version with %s.", version, archiveURL, code, env.RuntimeVersion)
-			if code = ctx.HTTPStatus(archiveAltURL); code != http.StatusOK {
-				return gcp.UserErrorf("Runtime version %s does not exist at %s (status %d). You can specify the version with %s.", version, archiveAltURL, code, env.RuntimeVersion)
-			}
-			finalArchiveURL = archiveAltURL
+		// Check GOOGLE_GO_ARCHIVE_PATH before downloading any archive. The
+		// version feed is still consulted to verify a pre-downloaded
+		// archive's checksum, but an air-gapped build that can't reach the
+		// feed installs the archive unverified.
+		archivePath, gotSHA256, usedLocal, err := localArchive(feed, version, goos, goarch)
+		if err != nil {
+			return err
+		}
+
+		var filename string
+		if usedLocal {
+			filename = filepath.Base(archivePath)
+			ctx.Logf("Installing Go v%s from %s", version, os.Getenv(goArchivePathEnv))
 		} else {
-			finalArchiveURL = archiveURL
+			// Only once we know the network is actually required to install
+			// Go is it worth fetching the feed to check whether this
+			// version is still supported.
+			if err := supportPolicy(ctx, feed, version); err != nil {
+				return err
+			}
+
+			file, err := archiveFileInfo(feed, version, goos, goarch)
+			if err != nil {
+				if _, feedErr := feed.get(); feedErr == nil {
+					return err
+				}
+				// The feed itself is unreachable: no checksum to check against.
+				file = nil
+			}
+
+			var wantSHA256 string
+			if file == nil {
+				// Older releases can fall off even the include=all feed.
+				// Don't block the install over it -- just skip integrity
+				// verification, same as when the feed itself is unreachable.
+				ctx.Warnf("No checksum available for Go %s on %s/%s in the version feed; skipping integrity verification.", version, goos, goarch)
+				filename = defaultFilename(version, goos, goarch)
+			} else {
+				wantSHA256 = file.SHA256
+				filename = file.Filename
+			}
+
+			finalArchiveURL, err := resolveArchiveURL(ctx, version, goos, goarch, filename)
+			if err != nil {
+				return err
+			}
+
+			// Download to a temp file first so the checksum can be verified
+			// before anything is extracted into the layer.
+			archiveFile, err := os.CreateTemp("", "go-archive-*-"+filename)
+			if err != nil {
+				return gcp.InternalErrorf("creating temp file for Go archive: %v", err)
+			}
+			archivePath = archiveFile.Name()
+			archiveFile.Close()
+			defer os.Remove(archivePath)
+
+			ctx.Logf("Installing Go v%s from %s", version, finalArchiveURL)
+			downloadCommand := fmt.Sprintf("curl --fail --show-error --silent --location --retry 3 --output %s %s", archivePath, finalArchiveURL)
+			ctx.Exec([]string{"bash", "-c", downloadCommand}, gcp.WithUserAttribution)
+
+			gotSHA256, err = sha256File(archivePath)
+			if err != nil {
+				return gcp.InternalErrorf("computing sha256 of Go archive: %v", err)
+			}
+			if wantSHA256 != "" && gotSHA256 != wantSHA256 {
+				ctx.ClearLayer(grl)
+				return gcp.InternalErrorf("sha256 mismatch for Go archive %s: got %s, want %s", finalArchiveURL, gotSHA256, wantSHA256)
+			}
 		}
 
-		// Download and install Go in layer.
-		ctx.Logf("Installing Go v%s", version)
-		command := fmt.Sprintf("curl --fail --show-error --silent --location --retry 3 %s | tar xz --directory %s --strip-components=1", finalArchiveURL, grl.Path)
-		ctx.Exec([]string{"bash", "-c", command}, gcp.WithUserAttribution)
+		ctx.Exec([]string{"bash", "-c", extractCommand(archivePath, grl.Path, filename)}, gcp.WithUserAttribution)
 		ctx.SetMetadata(grl, versionKey, version)
+		ctx.SetMetadata(grl, sha256Key, gotSHA256)
 	}
 
 	return nil
 }
 
-func runtimeVersion(ctx *gcp.Context) (string, error) {
-	if version := os.Getenv(env.RuntimeVersion); version != "" {
-		ctx.Logf("Using runtime version from %s: %s", env.RuntimeVersion, version)
+// sha256File returns the lowercase hex-encoded SHA256 digest of the file at path.
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// localArchive checks GOOGLE_GO_ARCHIVE_PATH for a pre-downloaded archive for
+// version/goos/goarch. If found, it returns the local path and its checksum
+// with used=true, so the caller can install it without downloading an
+// archive. To verify it, the version feed is fetched if no earlier call has
+// fetched it already. When the version feed is reachable and knows this
+// version/platform, the archive's checksum is verified against it; when it
+// isn't (the air-gapped case GOOGLE_GO_ARCHIVE_PATH exists for), the local
+// archive is trusted unverified rather than failing the build over it.
+func localArchive(feed *releaseFeed, version, goos, goarch string) (path, sha256sum string, used bool, err error) {
+	localPath := os.Getenv(goArchivePathEnv)
+	if localPath == "" {
+		return "", "", false, nil
+	}
+	if _, err := os.Stat(localPath); err != nil {
+		return "", "", false, nil
+	}
+	gotSHA256, err := sha256File(localPath)
+	if err != nil {
+		return "", "", false, gcp.InternalErrorf("computing sha256 of %s: %v", localPath, err)
+	}
+	if file, ferr := archiveFileInfo(feed, version, goos, goarch); ferr == nil && file != nil && file.SHA256 != "" {
+		if file.SHA256 != gotSHA256 {
+			return "", "", false, gcp.UserErrorf("local Go archive %s does not match the published sha256 for Go %s (%s/%s): got %s, want %s", localPath, version, goos, goarch, gotSHA256, file.SHA256)
+		}
+	}
+	return localPath, gotSHA256, true, nil
+}
+
+// goMirrorTemplates returns the configured GOOGLE_GO_MIRROR archive URL
+// templates, each with %s placeholders for version, OS, and arch in order.
+func goMirrorTemplates() []string {
+	v := os.Getenv(goMirrorEnv)
+	if v == "" {
+		return nil
+	}
+	var templates []string
+	for _, t := range strings.Split(v, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			templates = append(templates, t)
+		}
+	}
+	return templates
+}
+
+// resolveArchiveURL returns the first reachable archive URL for the given Go
+// version, platform, and archive filename, trying GOOGLE_GO_MIRROR templates
+// (which take version/OS/arch) in order before falling back to the default
+// Google-hosted CDNs (which take the filename itself).
+func resolveArchiveURL(ctx *gcp.Context, version, goos, goarch, filename string) (string, error) {
+	var candidates []string
+	for _, tmpl := range goMirrorTemplates() {
+		candidates = append(candidates, fmt.Sprintf(tmpl, version, goos, goarch))
+	}
+	candidates = append(candidates, fmt.Sprintf(goURL, filename), fmt.Sprintf(goAltURL, filename))
+
+	for _, u := range candidates {
+		if code := ctx.HTTPStatus(u); code == http.StatusOK {
+			return u, nil
+		} else {
+			ctx.Logf("Runtime version %s does not exist at %s (status %d).", version, u, code)
+		}
+	}
+	return "", gcp.UserErrorf("Go %s for %s/%s was not found at any configured mirror. You can specify the version with %s or add a mirror with %s.", version, goos, goarch, env.RuntimeVersion, goMirrorEnv)
+}
+
+// fetchReleases downloads and parses the dl.golang.org (or dl.golang.google.cn)
+// version feed listing every Go release and its per-platform archives. It
+// uses ExecWithErr rather than Exec so a network failure (e.g. an air-gapped
+// build) comes back as an ordinary error instead of aborting the build.
+// Callers that can do without the feed (supportPolicy, resolveToLatestPatch,
+// localArchive, cachedSHA256Valid, and buildFn's checksum lookup) carry on
+// without it; resolveVersionSpec for a non-exact spec and latestGoVersion
+// need it to pick a version and return the error.
+func fetchReleases(ctx *gcp.Context) (goReleases, error) {
+	finalGoVersionURL := os.Getenv(goVersionManifestURLEnv)
+	if finalGoVersionURL == "" {
+		if userNetwork := golang.DetectNetwork(ctx); userNetwork == golang.AlternativeUserNetwork {
+			finalGoVersionURL = goAltVersionURL
+		} else {
+			finalGoVersionURL = goVersionURL
+		}
+	}
+	result, err := ctx.ExecWithErr([]string{"curl", "--fail", "--show-error", "--silent", "--location", finalGoVersionURL}, gcp.WithUserAttribution)
+	if err != nil {
+		return nil, fmt.Errorf("fetching Go version feed from %q: %w", finalGoVersionURL, err)
+	}
+
+	releases := goReleases{}
+	if err := json.Unmarshal([]byte(result.Stdout), &releases); err != nil {
+		return nil, fmt.Errorf("parsing JSON response from URL %q: %v", finalGoVersionURL, err)
+	}
+	return releases, nil
+}
+
+// releaseFeed memoizes a single fetchReleases call for the lifetime of a
+// build, so the several helpers below that all need the version manifest
+// (supportPolicy, resolveVersionSpec, archiveFileInfo, ...) share one
+// download instead of each fetching it independently.
+type releaseFeed struct {
+	ctx      *gcp.Context
+	fetched  bool
+	releases goReleases
+	err      error
+}
+
+// newReleaseFeed returns a releaseFeed that fetches the version manifest at
+// most once, on first use.
+func newReleaseFeed(ctx *gcp.Context) *releaseFeed {
+	return &releaseFeed{ctx: ctx}
+}
+
+// get returns the version manifest, fetching it on the first call and
+// reusing that result (or error) on every subsequent call.
+func (f *releaseFeed) get() (goReleases, error) {
+	if !f.fetched {
+		f.releases, f.err = fetchReleases(f.ctx)
+		f.fetched = true
+	}
+	return f.releases, f.err
+}
+
+// peek returns the version manifest only if some earlier call to get has
+// already fetched it successfully, without triggering a fetch of its own.
+// It's for callers like cachedSHA256Valid that want to opportunistically
+// reuse an already-fetched feed but have no reason to fetch one themselves.
+func (f *releaseFeed) peek() (goReleases, bool) {
+	if !f.fetched || f.err != nil {
+		return nil, false
+	}
+	return f.releases, true
+}
+
+// cachedSHA256Valid reports whether a cache-hit layer's stored checksum
+// still matches the version feed's checksum for this version/platform. A
+// mismatch means the cached install no longer matches what's expected and
+// should be treated as a cache miss. Layers from before this checksum was
+// tracked (metaSHA256 == ""), and versions/platforms the feed doesn't (or
+// can't) speak to, are given the benefit of the doubt, since there's
+// nothing to compare against. This never fetches the feed itself -- a warm
+// cache hit shouldn't need the network at all -- it only reuses one already
+// fetched for some other reason earlier in the build.
+func cachedSHA256Valid(feed *releaseFeed, version, metaSHA256 string) bool {
+	if metaSHA256 == "" {
+		return true
+	}
+	releases, ok := feed.peek()
+	if !ok {
+		return true
+	}
+	goos, goarch := goPlatform()
+	for _, release := range releases {
+		if strings.TrimPrefix(release.Version, "go") != version {
+			continue
+		}
+		for _, f := range release.Files {
+			if f.Kind == "archive" && f.OS == goos && f.Arch == goarch {
+				if f.SHA256 == "" {
+					return true
+				}
+				return f.SHA256 == metaSHA256
+			}
+		}
+	}
+	return true
+}
+
+// archiveFileInfo looks up the release file entry matching the given Go
+// version and target platform from the dl.golang.org version feed. It
+// returns a nil *goFileInfo (not an error) if version itself isn't listed in
+// the feed at all -- older releases can fall off even the include=all feed,
+// so the caller should fall back to a best-effort filename rather than fail.
+// If version IS listed but has no archive for this platform, that platform
+// genuinely isn't published for it, which is reported as a UserErrorf.
+func archiveFileInfo(feed *releaseFeed, version, goos, goarch string) (*goFileInfo, error) {
+	releases, err := feed.get()
+	if err != nil {
+		return nil, err
+	}
+
+	var releaseListed bool
+	for _, release := range releases {
+		if strings.TrimPrefix(release.Version, "go") != version {
+			continue
+		}
+		releaseListed = true
+		for _, f := range release.Files {
+			if f.Kind == "archive" && f.OS == goos && f.Arch == goarch {
+				f := f
+				return &f, nil
+			}
+		}
+	}
+	if releaseListed {
+		return nil, gcp.UserErrorf("Go %s has no release archive published for %s/%s", version, goos, goarch)
+	}
+	return nil, nil
+}
+
+// goPlatform returns the OS and architecture, in the naming used by the Go
+// release archives (e.g. "linux"/"amd64", "linux"/"armv6l"), to install.
+// GOOGLE_GO_OS and GOOGLE_GO_ARCH override the builder's own runtime.GOOS
+// and runtime.GOARCH, using the same names Go itself uses for GOOS/GOARCH.
+func goPlatform() (goos, goarch string) {
+	goos = goruntime.GOOS
+	if v := os.Getenv(goOSEnv); v != "" {
+		goos = v
+	}
+	goarch = goruntime.GOARCH
+	if v := os.Getenv(goArchEnv); v != "" {
+		goarch = v
+	}
+	return goos, mapGoArch(goarch)
+}
+
+// mapGoArch translates a Go GOARCH value to the architecture name used in Go
+// release archive filenames, matching the convention used by setup-go and
+// similar installers.
+func mapGoArch(goarch string) string {
+	switch goarch {
+	case "arm":
+		return "armv6l"
+	default:
+		return goarch
+	}
+}
+
+// archiveExt returns the file extension Go's own release archives use for
+// the given OS: zip for Windows, tar.gz everywhere else.
+func archiveExt(goos string) string {
+	if goos == "windows" {
+		return "zip"
+	}
+	return "tar.gz"
+}
+
+// defaultFilename returns the filename Go's release archives use for the
+// given version and platform, for when the version feed has no entry to
+// read the real filename from.
+func defaultFilename(version, goos, goarch string) string {
+	return fmt.Sprintf("go%s.%s-%s.%s", version, goos, goarch, archiveExt(goos))
+}
+
+// extractCommand returns the shell command that unpacks the archive at
+// archivePath into destDir, stripping the archive's single top-level "go"
+// directory the way tar's --strip-components=1 does. filename determines
+// whether the archive is a zip (Windows) or a tar.gz (everything else).
+func extractCommand(archivePath, destDir, filename string) string {
+	if strings.HasSuffix(filename, ".zip") {
+		return fmt.Sprintf("rm -rf %[1]s.tmp && mkdir -p %[1]s.tmp && unzip -q %[2]s -d %[1]s.tmp && rm -rf %[1]s && mv %[1]s.tmp/go %[1]s && rmdir %[1]s.tmp", destDir, archivePath)
+	}
+	return fmt.Sprintf("tar xz --directory %s --strip-components=1 --file %s", destDir, archivePath)
+}
+
+func runtimeVersion(ctx *gcp.Context, feed *releaseFeed) (string, error) {
+	if spec := os.Getenv(env.RuntimeVersion); spec != "" {
+		version, err := resolveVersionSpec(feed, spec)
+		if err != nil {
+			return "", err
+		}
+		ctx.Logf("Using runtime version from %s (%s): %s", env.RuntimeVersion, spec, version)
 		return version, nil
 	}
 	if version := golang.GoModVersion(ctx); version != "" {
+		version = resolveGoModToolchain(ctx, version)
+		version = resolveToLatestPatch(feed, version)
 		ctx.Logf("Using runtime version from go.mod: %s", version)
 		return version, nil
 	}
-	version, err := latestGoVersion(ctx)
+	version, err := latestGoVersion(feed)
 	if err != nil {
 		return "", fmt.Errorf("getting latest version: %w", err)
 	}
@@ -110,29 +496,272 @@ func runtimeVersion(ctx *gcp.Context) (string, error) {
 	return version, nil
 }
 
-type goReleases []struct {
-	Version string `json:"version"`
-	Stable  bool   `json:"stable"`
+// resolveGoModToolchain applies the go.mod `toolchain` directive (Go 1.21+)
+// and the GOTOOLCHAIN env var on top of the `go` directive's version,
+// following the same precedence as the go command itself: the toolchain
+// directive supersedes the go directive when GOTOOLCHAIN allows it.
+func resolveGoModToolchain(ctx *gcp.Context, goDirectiveVersion string) string {
+	switch gt := os.Getenv(goToolchainEnv); {
+	case gt == "local":
+		// Toolchain resolution disabled: always use the go directive.
+		return goDirectiveVersion
+	case gt != "" && gt != "auto":
+		// An explicit "goX.Y.Z" pin overrides go.mod entirely.
+		return strings.TrimPrefix(gt, "go")
+	default:
+		toolchain := golang.GoModToolchain(ctx)
+		tcVersion := strings.TrimPrefix(toolchain, "go")
+		if tcVersion == "" {
+			return goDirectiveVersion
+		}
+		if semver.Compare("v"+tcVersion, "v"+goDirectiveVersion) > 0 {
+			ctx.Logf("Using toolchain %s from go.mod (supersedes go directive %s)", tcVersion, goDirectiveVersion)
+			return tcVersion
+		}
+		return goDirectiveVersion
+	}
 }
 
-// latestGoVersion returns the latest version of Go
-func latestGoVersion(ctx *gcp.Context) (string, error) {
-	var finalGoVersionURL string
-	if userNetwork := golang.DetectNetwork(ctx); userNetwork == golang.AlternativeUserNetwork {
-		finalGoVersionURL = goAltVersionURL
-	} else {
-		finalGoVersionURL = goVersionURL
+// resolveVersionSpec resolves a GOOGLE_RUNTIME_VERSION value to a concrete Go
+// release version. spec may be an exact version ("1.21.3"), the aliases
+// "stable"/"oldstable" (as popularized by actions/setup-go), or a semver
+// constraint such as "1.21.x" or "^1.21".
+func resolveVersionSpec(feed *releaseFeed, spec string) (string, error) {
+	if isExactVersion(spec) {
+		// An exact pin always resolves to itself. It doesn't need to appear
+		// in the feed, so this works even for very old releases that have
+		// fallen off it, or when the feed is unreachable.
+		return spec, nil
+	}
+
+	releases, err := feed.get()
+	if err != nil {
+		return "", err
+	}
+
+	var stableVersions []string
+	for _, r := range releases {
+		if r.Stable {
+			stableVersions = append(stableVersions, strings.TrimPrefix(r.Version, "go"))
+		}
 	}
-	result := ctx.Exec([]string{"curl", "--fail", "--show-error", "--silent", "--location", finalGoVersionURL}, gcp.WithUserAttribution)
-	return parseVersionJSON(result.Stdout)
+
+	switch spec {
+	case "stable":
+		if v := newestMatching(stableVersions, ""); v != "" {
+			return v, nil
+		}
+		return "", gcp.UserErrorf("could not find a stable Go release")
+	case "oldstable":
+		latest := newestMatching(stableVersions, "")
+		if latest == "" {
+			return "", gcp.UserErrorf("could not find a stable Go release")
+		}
+		oldMinor := prevMinorSeries(majorMinor(latest))
+		if v := newestMatching(stableVersions, oldMinor); v != "" {
+			return v, nil
+		}
+		return "", gcp.UserErrorf("could not find a stable Go release in the %s series", oldMinor)
+	}
+
+	var best string
+	for _, v := range stableVersions {
+		if !versionSatisfies(spec, v) {
+			continue
+		}
+		if best == "" || semver.Compare("v"+v, "v"+best) > 0 {
+			best = v
+		}
+	}
+	if best == "" {
+		return "", gcp.UserErrorf("no Go release matches version constraint %q; closest available versions: %s", spec, strings.Join(closestSeries(stableVersions), ", "))
+	}
+	return best, nil
 }
 
-func parseVersionJSON(jsonStr string) (string, error) {
-	releases := goReleases{}
-	if err := json.Unmarshal([]byte(jsonStr), &releases); err != nil {
-		return "", fmt.Errorf("parsing JSON response from URL %q: %v", goVersionURL, err)
+// versionSatisfies reports whether version matches the semver-ish constraint
+// spec: an exact version, a "major.minor" or "major.minor.x" prefix, or a
+// "^major.minor[.patch]" lower bound within the same major version.
+func versionSatisfies(spec, version string) bool {
+	if strings.HasPrefix(spec, "^") {
+		base := strings.TrimPrefix(spec, "^")
+		return semver.Major("v"+version) == semver.Major("v"+base) && semver.Compare("v"+version, "v"+base) >= 0
+	}
+	prefix := strings.TrimSuffix(spec, ".x")
+	return version == prefix || strings.HasPrefix(version, prefix+".")
+}
+
+// isExactVersion reports whether v is a fully qualified "major.minor.patch"
+// version, e.g. "1.21.3".
+func isExactVersion(v string) bool {
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	for _, p := range parts {
+		if p == "" {
+			return false
+		}
+		for _, r := range p {
+			if r < '0' || r > '9' {
+				return false
+			}
+		}
 	}
+	return true
+}
 
+// resolveToLatestPatch resolves a two-part "major.minor" version, such as
+// the one from a go.mod `go` directive, to the newest matching patch release
+// in the feed. An already-exact version, or one the feed can't resolve (e.g.
+// it's unreachable), is returned unchanged.
+func resolveToLatestPatch(feed *releaseFeed, version string) string {
+	if isExactVersion(version) {
+		return version
+	}
+	releases, err := feed.get()
+	if err != nil {
+		return version
+	}
+	var stableVersions []string
+	for _, r := range releases {
+		if r.Stable {
+			stableVersions = append(stableVersions, strings.TrimPrefix(r.Version, "go"))
+		}
+	}
+	if v := newestMatching(stableVersions, majorMinor(version)); v != "" {
+		return v
+	}
+	return version
+}
+
+// majorMinor returns the "major.minor" series of a dotted Go version, e.g.
+// "1.21.3" -> "1.21".
+func majorMinor(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// prevMinorSeries returns the "major.minor" series immediately before the
+// given one, e.g. "1.21" -> "1.20".
+func prevMinorSeries(series string) string {
+	major, minorStr, ok := strings.Cut(series, ".")
+	if !ok {
+		return series
+	}
+	var minor int
+	fmt.Sscanf(minorStr, "%d", &minor)
+	if minor <= 0 {
+		return series
+	}
+	return fmt.Sprintf("%s.%d", major, minor-1)
+}
+
+// newestMatching returns the newest version in versions whose "major.minor"
+// series matches the given series, or the newest version overall if series
+// is empty.
+func newestMatching(versions []string, series string) string {
+	var best string
+	for _, v := range versions {
+		if series != "" && majorMinor(v) != series {
+			continue
+		}
+		if best == "" || semver.Compare("v"+v, "v"+best) > 0 {
+			best = v
+		}
+	}
+	return best
+}
+
+// closestSeries returns the most recent "major.minor" series present in
+// versions, for use in error messages when a constraint matches nothing.
+func closestSeries(versions []string) []string {
+	series := seriesDesc(versions)
+	if len(series) > 5 {
+		series = series[:5]
+	}
+	return series
+}
+
+// seriesDesc returns the distinct "major.minor" series present in versions,
+// newest first.
+func seriesDesc(versions []string) []string {
+	seen := map[string]bool{}
+	var series []string
+	for _, v := range versions {
+		s := majorMinor(v)
+		if !seen[s] {
+			seen[s] = true
+			series = append(series, s)
+		}
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return semver.Compare("v"+series[i]+".0", "v"+series[j]+".0") > 0
+	})
+	return series
+}
+
+// supportPolicy warns (or, with GOOGLE_GO_ENFORCE_SUPPORTED=true, fails the
+// build) when version is outside the two most recent minor series, which is
+// all the Go team actively supports at any given time. The check is skipped
+// if the release feed can't be reached, so transient network issues never
+// break a build.
+func supportPolicy(ctx *gcp.Context, feed *releaseFeed, version string) error {
+	releases, err := feed.get()
+	if err != nil {
+		ctx.Logf("Could not check whether Go %s is still supported: %v", version, err)
+		return nil
+	}
+
+	var stableVersions []string
+	for _, r := range releases {
+		if r.Stable {
+			stableVersions = append(stableVersions, strings.TrimPrefix(r.Version, "go"))
+		}
+	}
+
+	supported := seriesDesc(stableVersions)
+	if len(supported) > supportedSeriesCount {
+		supported = supported[:supportedSeriesCount]
+	}
+	series := majorMinor(version)
+	for _, s := range supported {
+		if s == series {
+			return nil
+		}
+	}
+
+	msg := fmt.Sprintf("Go %s is no longer supported by the Go team; only the %s series are currently supported. Consider upgrading.", version, strings.Join(supported, " and "))
+	if os.Getenv(goEnforceSupportedEnv) == "true" {
+		return gcp.UserErrorf("%s", msg)
+	}
+	ctx.Warnf("%s", msg)
+	return nil
+}
+
+type goReleases []struct {
+	Version string       `json:"version"`
+	Stable  bool         `json:"stable"`
+	Files   []goFileInfo `json:"files"`
+}
+
+type goFileInfo struct {
+	Filename string `json:"filename"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	Kind     string `json:"kind"`
+	SHA256   string `json:"sha256"`
+}
+
+// latestGoVersion returns the latest stable version of Go.
+func latestGoVersion(feed *releaseFeed) (string, error) {
+	releases, err := feed.get()
+	if err != nil {
+		return "", err
+	}
 	for _, release := range releases {
 		if !release.Stable {
 			continue
@@ -0,0 +1,41 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package golang contains Go buildpack library code.
+package golang
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/mod/modfile"
+
+	gcp "github.com/GoogleCloudPlatform/buildpacks/pkg/gcpbuildpack"
+)
+
+// GoModToolchain returns the version named by go.mod's `toolchain` directive
+// (Go 1.21+), e.g. "go1.21.5", or "" if go.mod has no `toolchain` line or
+// does not exist.
+func GoModToolchain(ctx *gcp.Context) string {
+	modPath := filepath.Join(ctx.ApplicationRoot(), "go.mod")
+	data, err := os.ReadFile(modPath)
+	if err != nil {
+		return ""
+	}
+	f, err := modfile.Parse(modPath, data, nil)
+	if err != nil || f.Toolchain == nil {
+		return ""
+	}
+	return f.Toolchain.Name
+}